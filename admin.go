@@ -3,6 +3,7 @@ package ghost
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -19,14 +20,21 @@ const (
 	BaseAdminPath = "/ghost/api/v3/admin/"
 )
 
+// ErrReadOnlyClient is returned when a client created WithReadOnly is used to
+// send a request that could modify content.
+var ErrReadOnlyClient = errors.New("ghost: client is read-only")
+
 // An AdminClient manages communication with the Ghost Admin API
 type AdminClient struct {
 	client    *http.Client
 	BaseURL   *url.URL
 	UserAgent string
 
+	readOnly bool
+
 	Authentication *AdminAuthenticationService
 	Database       *AdminDatabaseService
+	Images         *AdminImagesService
 	Posts          *AdminPostsService
 	Redirects      *AdminRedirectsService
 	Session        *AdminSessionService
@@ -39,12 +47,26 @@ type adminService struct {
 	client *AdminClient
 }
 
+// AdminClientOption configures an AdminClient.
+type AdminClientOption func(*AdminClient)
+
+// WithReadOnly makes the client refuse any request other than a GET, failing
+// with ErrReadOnlyClient before anything is sent. Use it for clients that must
+// never mutate content, such as for analytics and reporting. Creating a session
+// is still allowed, as it changes no content, so both token and session based
+// authentication work.
+func WithReadOnly() AdminClientOption {
+	return func(c *AdminClient) {
+		c.readOnly = true
+	}
+}
+
 // NewAdminClient returns a new client for interacting with Ghost Admin endpoints.
 // baseURL should be the base admin url of the intance, in most cases taking the form
 // of e.g., https://blah.pubbit.io with no trailing slash. It may additionally
 // contain the subpath, but that too must omit the trailing slash.
 // httpClient should handle authentication itself
-func NewAdminClient(baseURL string, httpClient *http.Client) (*AdminClient, error) {
+func NewAdminClient(baseURL string, httpClient *http.Client, opts ...AdminClientOption) (*AdminClient, error) {
 	burl, err := parseBaseURL(baseURL)
 	if err != nil {
 		return nil, err
@@ -57,9 +79,13 @@ func NewAdminClient(baseURL string, httpClient *http.Client) (*AdminClient, erro
 	c.common.client = c
 	c.Authentication = (*AdminAuthenticationService)(&c.common)
 	c.Database = (*AdminDatabaseService)(&c.common)
+	c.Images = (*AdminImagesService)(&c.common)
 	c.Posts = (*AdminPostsService)(&c.common)
 	c.Redirects = (*AdminRedirectsService)(&c.common)
 	c.Session = (*AdminSessionService)(&c.common)
+	for _, opt := range opts {
+		opt(c)
+	}
 	return c, nil
 }
 
@@ -172,8 +198,13 @@ func (c *AdminClient) NewUploadRequest(urlStr string, writePart WriteFilePart, p
 // JSON decoded and stored in the value pointed to by v, or returned as an
 // error if an API error has occurred. If v implements the io.Writer
 // interface, the raw response body will be written to v, without attempting to
-// first decode it.
+// first decode it. If the client is read-only, any request other than a GET
+// or the creation of a session fails with ErrReadOnlyClient without being sent.
 func (c *AdminClient) Do(req *http.Request, v interface{}) (*http.Response, error) {
+	if c.readOnly && req.Method != "GET" && !c.isSessionRequest(req) {
+		return nil, ErrReadOnlyClient
+	}
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -201,6 +232,11 @@ func (c *AdminClient) Do(req *http.Request, v interface{}) (*http.Response, erro
 	return resp, err
 }
 
+// isSessionRequest reports whether req creates a session.
+func (c *AdminClient) isSessionRequest(req *http.Request) bool {
+	return req.Method == "POST" && req.URL.Path == c.BaseURL.Path+"session/"
+}
+
 // addOptions adds the parameters in opt as URL query parameters to s. opt
 // must be a struct whose fields may contain "url" tags.
 func addOptions(s string, opts interface{}) (string, error) {
@@ -1,7 +1,9 @@
 package ghost
 
 import (
+	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,6 +15,11 @@ func TestNewAdminClient(t *testing.T) {
 	c, err := NewAdminClient("https://demo.pubbit.co", &http.Client{})
 	require.NoError(t, err)
 	require.NotNil(t, c.client)
+	require.False(t, c.readOnly)
+
+	c, err = NewAdminClient("https://demo.pubbit.co", &http.Client{}, WithReadOnly())
+	require.NoError(t, err)
+	require.True(t, c.readOnly)
 }
 
 // setup sets up a test HTTP server along with a ghost.AdminClient that is
@@ -34,3 +41,45 @@ func setup() (client *AdminClient, mux *http.ServeMux, serverURL string, teardow
 
 	return client, mux, server.URL, server.Close
 }
+
+func TestAdminClient_ReadOnly(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+
+	var writes int
+	mux.HandleFunc(BaseAdminPath+"posts/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			writes++
+		}
+		fmt.Fprint(w, `{ "posts": [{"id": "1"}] }`)
+	})
+	WithReadOnly()(client)
+
+	_, err := client.Posts.Get("1")
+	require.NoError(t, err)
+
+	_, err = client.Posts.Update(&Post{ID: String("1")})
+	require.Equal(t, ErrReadOnlyClient, err)
+
+	req, err := client.NewUploadRequest("posts/1/", func(mpw *multipart.Writer) error { return nil }, nil)
+	require.NoError(t, err)
+	_, err = client.Do(req, nil)
+	require.Equal(t, ErrReadOnlyClient, err)
+
+	require.Equal(t, 0, writes)
+}
+
+func TestAdminClient_ReadOnlySession(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc(BaseAdminPath+"session/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		w.WriteHeader(http.StatusCreated)
+	})
+	WithReadOnly()(client)
+
+	// logging in changes no content, so read-only clients may use sessions
+	err := client.Session.Create("username", "password")
+	require.NoError(t, err)
+}
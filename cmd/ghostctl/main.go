@@ -0,0 +1,129 @@
+// Command ghostctl performs maintenance tasks against a Ghost instance via the
+// Admin API.
+//
+// Usage:
+//
+//	ghostctl optimize-images -url https://admin.blah.pubbit.io -key <admin key> [-site-url https://blah.pubbit.io] [-dry-run]
+//
+// The admin key may also be given via the GHOST_ADMIN_KEY environment variable.
+// -site-url is needed when the admin url differs from the site url, as only
+// images served from the site are optimized.
+//
+// Images are re-encoded as JPEG, or PNG for PNGs, since the v3 Admin API does
+// not accept WebP uploads.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pubbit-co/go-ghost"
+	"golang.org/x/oauth2"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: ghostctl <command> [flags]\n\n")
+	fmt.Fprintf(os.Stderr, "commands:\n")
+	fmt.Fprintf(os.Stderr, "  optimize-images  resize and re-encode oversized images in all posts\n")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ghostctl: ")
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "optimize-images":
+		optimizeImages(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+// newClient creates an admin client authenticated with the admin key.
+func newClient(baseURL, key string, opts ...ghost.AdminClientOption) *ghost.AdminClient {
+	if key == "" {
+		key = os.Getenv("GHOST_ADMIN_KEY")
+	}
+	ts, err := ghost.NewAdminTokenSource(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	httpClient := oauth2.NewClient(context.Background(), ts)
+	client, err := ghost.NewAdminClient(baseURL, httpClient, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return client
+}
+
+func optimizeImages(args []string) {
+	fs := flag.NewFlagSet("optimize-images", flag.ExitOnError)
+	baseURL := fs.String("url", "", "base url of the Ghost instance, without trailing slash")
+	siteURL := fs.String("site-url", "", "public url of the site if it differs from -url")
+	key := fs.String("key", "", "admin api key (defaults to $GHOST_ADMIN_KEY)")
+	maxWidth := fs.Int("max-width", ghost.DefaultMaxImageWidth, "width in pixels to scale wider images down to")
+	minSize := fs.Int("min-size", ghost.DefaultMinImageSize, "size in bytes above which images are re-encoded")
+	dryRun := fs.Bool("dry-run", false, "report expected savings without changing anything")
+	fs.Parse(args)
+
+	if *baseURL == "" {
+		log.Fatal("-url is required")
+	}
+
+	var opts []ghost.AdminClientOption
+	if *dryRun {
+		// guarantee a dry run cannot touch anything
+		opts = append(opts, ghost.WithReadOnly())
+	}
+	client := newClient(*baseURL, *key, opts...)
+	report, err := client.Images.Optimize(&ghost.ImageOptimizeOptions{
+		MaxWidth: *maxWidth,
+		MinSize:  *minSize,
+		SiteURL:  *siteURL,
+		DryRun:   *dryRun,
+	})
+	// a failed run still reports what it changed before stopping
+	if report != nil {
+		printReport(report, *dryRun)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(report.Failures) > 0 {
+		os.Exit(1)
+	}
+}
+
+func printReport(report *ghost.ImageOptimizationReport, dryRun bool) {
+	for _, img := range report.Images {
+		fmt.Printf("%s: %d -> %d bytes (%d posts)\n", img.URL, img.OriginalSize, img.OptimizedSize, len(img.PostIDs))
+		if img.NewURL != "" {
+			fmt.Printf("  replaced with %s\n", img.NewURL)
+		}
+	}
+	for _, failure := range report.Failures {
+		if failure.PostID != "" {
+			fmt.Printf("post %s: failed to update: %v\n", failure.PostID, failure.Err)
+		} else {
+			fmt.Printf("%s: failed: %v\n", failure.URL, failure.Err)
+		}
+	}
+
+	verb := "saved"
+	if dryRun {
+		verb = "would save"
+	}
+	fmt.Printf("%d of %d images optimized, %s %d bytes\n", len(report.Images), report.Scanned, verb, report.Savings())
+	if report.Scanned == 0 {
+		fmt.Fprintln(os.Stderr, "no images found under the site url; use -site-url if it differs from -url")
+	}
+}
@@ -0,0 +1,254 @@
+package ghost
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// iccProfileHeader prefixes the APP2 segments a jpeg's ICC profile is
+	// stored in, followed by the segment's sequence number and count.
+	iccProfileHeader = "ICC_PROFILE\x00"
+
+	// maxICCChunk is the most profile data that fits in one APP2 segment.
+	maxICCChunk = 65535 - 2 - len(iccProfileHeader) - 2
+
+	// maxICCProfileSize bounds how much a compressed png profile may inflate to.
+	maxICCProfileSize = 4 * 1024 * 1024
+)
+
+// imageMetadata is what decoding and re-encoding an image would otherwise
+// lose and that changes how it is displayed.
+type imageMetadata struct {
+	// Orientation is the EXIF orientation, 0 or 1 when upright.
+	Orientation int
+
+	// ICCProfile is the embedded color profile, if any.
+	ICCProfile []byte
+}
+
+// readImageMetadata reads the metadata of src, which is in the given format
+// as reported by image.DecodeConfig.
+func readImageMetadata(src []byte, format string) (*imageMetadata, error) {
+	switch format {
+	case "jpeg":
+		return jpegMetadata(src), nil
+	case "png":
+		profile, err := pngICCProfile(src)
+		if err != nil {
+			return nil, err
+		}
+		return &imageMetadata{ICCProfile: profile}, nil
+	}
+	return &imageMetadata{}, nil
+}
+
+// jpegMetadata scans the jpeg's segments up to the image data for its EXIF
+// orientation and ICC profile.
+func jpegMetadata(src []byte) *imageMetadata {
+	meta := &imageMetadata{}
+	i := 2 // skip SOI
+	for i+4 <= len(src) {
+		if src[i] != 0xff {
+			return meta
+		}
+		marker := src[i+1]
+		if marker == 0xff {
+			// fill byte
+			i++
+			continue
+		}
+		if marker == 0xd8 || marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			// markers without a length
+			i += 2
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			// start of scan or end of image, no more metadata
+			return meta
+		}
+
+		length := int(binary.BigEndian.Uint16(src[i+2:]))
+		if length < 2 || i+2+length > len(src) {
+			return meta
+		}
+		segment := src[i+4 : i+2+length]
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			meta.Orientation = exifOrientation(segment[6:])
+		case marker == 0xe2 && bytes.HasPrefix(segment, []byte(iccProfileHeader)) &&
+			len(segment) >= len(iccProfileHeader)+2:
+			// the chunks of a profile are written in sequence
+			meta.ICCProfile = append(meta.ICCProfile, segment[len(iccProfileHeader)+2:]...)
+		}
+		i += 2 + length
+	}
+	return meta
+}
+
+// exifOrientation returns the orientation tag of the TIFF structure within an
+// EXIF segment, or 0 if it has none.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int64(order.Uint32(tiff[4:]))
+	if ifd+2 > int64(len(tiff)) {
+		return 0
+	}
+	entries := int64(order.Uint16(tiff[ifd:]))
+	for n := int64(0); n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > int64(len(tiff)) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// pngICCProfile returns the ICC profile of the png's iCCP chunk, if any.
+func pngICCProfile(src []byte) ([]byte, error) {
+	i := 8 // skip signature
+	for i+8 <= len(src) {
+		length := int64(binary.BigEndian.Uint32(src[i:]))
+		next := int64(i) + 12 + length
+		if next > int64(len(src)) {
+			return nil, nil
+		}
+
+		switch string(src[i+4 : i+8]) {
+		case "iCCP":
+			// the profile name is followed by the compression method
+			data := src[i+8 : i+8+int(length)]
+			nul := bytes.IndexByte(data, 0)
+			if nul < 0 || nul+2 > len(data) {
+				return nil, fmt.Errorf("malformed png color profile")
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(data[nul+2:]))
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			return ioutil.ReadAll(io.LimitReader(zr, maxICCProfileSize))
+		case "IDAT":
+			// the profile must come before the image data
+			return nil, nil
+		}
+		i = int(next)
+	}
+	return nil, nil
+}
+
+// embedICCProfile inserts profile into the encoded image of the given mime
+// type, returning the new encoding.
+func embedICCProfile(encoded []byte, contentType string, profile []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		if len(encoded) < 2 {
+			return nil, fmt.Errorf("malformed jpeg")
+		}
+		count := (len(profile) + maxICCChunk - 1) / maxICCChunk
+		if count > 255 {
+			return nil, fmt.Errorf("color profile too large to embed")
+		}
+
+		// the profile goes in APP2 segments right after SOI
+		out := append([]byte{}, encoded[:2]...)
+		for n := 0; n < count; n++ {
+			chunk := profile[n*maxICCChunk:]
+			if len(chunk) > maxICCChunk {
+				chunk = chunk[:maxICCChunk]
+			}
+			segment := []byte{0xff, 0xe2, 0, 0}
+			binary.BigEndian.PutUint16(segment[2:], uint16(2+len(iccProfileHeader)+2+len(chunk)))
+			segment = append(segment, iccProfileHeader...)
+			segment = append(segment, byte(n+1), byte(count))
+			out = append(append(out, segment...), chunk...)
+		}
+		return append(out, encoded[2:]...), nil
+	case "image/png":
+		// signature, then the IHDR chunk with its 13 bytes of data
+		const ihdrEnd = 8 + 12 + 13
+		if len(encoded) < ihdrEnd {
+			return nil, fmt.Errorf("malformed png")
+		}
+
+		data := &bytes.Buffer{}
+		data.WriteString("ICC Profile\x00\x00")
+		zw := zlib.NewWriter(data)
+		zw.Write(profile)
+		zw.Close()
+
+		chunk := make([]byte, 8, 12+data.Len())
+		binary.BigEndian.PutUint32(chunk, uint32(data.Len()))
+		copy(chunk[4:], "iCCP")
+		chunk = append(chunk, data.Bytes()...)
+		crc := make([]byte, 4)
+		binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+		chunk = append(chunk, crc...)
+
+		// the profile must come before the image data, so it follows IHDR
+		out := append([]byte{}, encoded[:ihdrEnd]...)
+		out = append(out, chunk...)
+		return append(out, encoded[ihdrEnd:]...), nil
+	}
+	return nil, fmt.Errorf("cannot embed a color profile in %s", contentType)
+}
+
+// orientImage applies the EXIF orientation to m, returning it upright.
+func orientImage(m image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return m
+	}
+
+	b := m.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if orientation >= 5 {
+		// the orientations from 5 on swap the axes
+		width, height = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = width-1-x, y
+			case 3: // rotated 180°
+				dx, dy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, height-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = width-1-y, x
+			case 7: // transversed
+				dx, dy = width-1-y, height-1-x
+			case 8: // rotated 90° counter clockwise
+				dx, dy = y, height-1-x
+			}
+			dst.Set(dx, dy, m.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
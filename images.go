@@ -0,0 +1,61 @@
+package ghost
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+)
+
+// AdminImagesService handles uploading images to Ghost.
+type AdminImagesService adminService
+
+// Image is an image stored by Ghost.
+type Image struct {
+	URL *string `json:"url"`
+	Ref *string `json:"ref"`
+}
+
+func (i Image) String() string {
+	return Stringify(i)
+}
+
+// imagesWrapper is the form of the response we get that we later flatten.
+type imagesWrapper struct {
+	Images []*Image `json:"images"`
+}
+
+// Upload uploads the image read from r under the given filename. contentType
+// should be the mime type of the image, e.g. image/jpeg. If ref is non-empty it
+// is sent along and echoed back by Ghost, which is handy for matching uploads
+// to the content that references them.
+func (s *AdminImagesService) Upload(filename, contentType string, r io.Reader, ref string) (*Image, error) {
+	imageWriter := func(mpw *multipart.Writer) error {
+		part, err := createFormFile(mpw, "file", filename, contentType)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(part, r)
+		return err
+	}
+
+	var params map[string]string
+	if ref != "" {
+		params = map[string]string{"ref": ref}
+	}
+
+	req, err := s.client.NewUploadRequest("images/upload/", imageWriter, params)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper := new(imagesWrapper)
+	_, err = s.client.Do(req, wrapper)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapper.Images) != 1 {
+		return nil, fmt.Errorf("received unexpected response format")
+	}
+	return wrapper.Images[0], nil
+}
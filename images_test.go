@@ -0,0 +1,404 @@
+package ghost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImagesService_Upload(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc(BaseAdminPath+"images/upload/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("FormFile returned error: %v", err)
+		}
+		if header.Filename != "a.png" {
+			t.Errorf("Images.Upload sent filename %v, want a.png", header.Filename)
+		}
+		if got := header.Header.Get("Content-Type"); got != "image/png" {
+			t.Errorf("Images.Upload sent content type %v, want image/png", got)
+		}
+		body, _ := ioutil.ReadAll(file)
+		if string(body) != "data" {
+			t.Errorf("Images.Upload sent %q, want %q", body, "data")
+		}
+		if ref := r.FormValue("ref"); ref != "r" {
+			t.Errorf("Images.Upload sent ref %v, want r", ref)
+		}
+		fmt.Fprint(w, `{ "images": [{"url": "https://x/content/images/a.png", "ref": "r"}] }`)
+	})
+
+	img, err := client.Images.Upload("a.png", "image/png", strings.NewReader("data"), "r")
+	if err != nil {
+		t.Errorf("Images.Upload returned error: %v", err)
+	}
+
+	want := &Image{URL: String("https://x/content/images/a.png"), Ref: String("r")}
+	if !reflect.DeepEqual(img, want) {
+		t.Errorf("Images.Upload returned %+v, want %+v", img, want)
+	}
+}
+
+// testPNG encodes a noisy width x height png, which will not compress well.
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	m := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			m.Set(x, y, color.NRGBA{uint8(x * 7), uint8(y * 13), uint8(x * y), 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImagesService_Optimize(t *testing.T) {
+	for _, dryRun := range []bool{true, false} {
+		t.Run(fmt.Sprintf("dryRun=%v", dryRun), func(t *testing.T) {
+			client, mux, serverURL, teardown := setup()
+			defer teardown()
+
+			large := testPNG(t, 64, 64)
+			small := testPNG(t, 8, 8)
+			mux.HandleFunc("/content/images/large.png", func(w http.ResponseWriter, r *http.Request) {
+				w.Write(large)
+			})
+			mux.HandleFunc("/content/images/small.png", func(w http.ResponseWriter, r *http.Request) {
+				w.Write(small)
+			})
+
+			largeURL := serverURL + "/content/images/large.png"
+			newURL := serverURL + "/content/images/large-2.png"
+			mobiledoc := fmt.Sprintf(`{"cards":[["image",{"src":"%s"}],["image",{"src":"%s"}]]}`,
+				largeURL, serverURL+"/content/images/small.png")
+			mux.HandleFunc(BaseAdminPath+"posts/", func(w http.ResponseWriter, r *http.Request) {
+				testMethod(t, r, "GET")
+				if order := r.FormValue("order"); order != "id asc" {
+					t.Errorf("Images.Optimize listed posts by %q, want id asc", order)
+				}
+				if r.FormValue("page") == "1" {
+					fmt.Fprintf(w, `{"posts": [{"id": "1", "feature_image": "%s", "mobiledoc": %q}],
+						"meta": {"pagination": {"next": 2}}}`, largeURL, mobiledoc)
+				} else {
+					fmt.Fprint(w, `{"posts": [{"id": "2", "feature_image": "https://unsplash.com/a.png"}],
+						"meta": {"pagination": {}}}`)
+				}
+			})
+
+			var uploads int
+			mux.HandleFunc(BaseAdminPath+"images/upload/", func(w http.ResponseWriter, r *http.Request) {
+				uploads++
+				fmt.Fprintf(w, `{"images": [{"url": "%s"}]}`, newURL)
+			})
+
+			var updated *Post
+			mux.HandleFunc(BaseAdminPath+"posts/1/", func(w http.ResponseWriter, r *http.Request) {
+				testMethod(t, r, "PUT")
+				body, _ := ioutil.ReadAll(r.Body)
+				wrapper := new(postsWrapper)
+				if err := json.Unmarshal(body, wrapper); err != nil {
+					t.Fatal(err)
+				}
+				updated = wrapper.Posts[0]
+				w.Write(body)
+			})
+
+			report, err := client.Images.Optimize(&ImageOptimizeOptions{MaxWidth: 16, DryRun: dryRun})
+			if err != nil {
+				t.Fatalf("Images.Optimize returned error: %v", err)
+			}
+
+			if len(report.Failures) != 0 {
+				t.Errorf("Images.Optimize reported failures %+v", report.Failures)
+			}
+			if report.Scanned != 2 {
+				t.Errorf("Images.Optimize scanned %d images, want 2", report.Scanned)
+			}
+			if len(report.Images) != 1 {
+				t.Fatalf("Images.Optimize optimized %d images, want 1", len(report.Images))
+			}
+			img := report.Images[0]
+			if img.URL != largeURL || img.OriginalSize != len(large) ||
+				!reflect.DeepEqual(img.PostIDs, []string{"1"}) {
+				t.Errorf("Images.Optimize returned %+v", img)
+			}
+			if report.Savings() <= 0 {
+				t.Errorf("Images.Optimize saved %d bytes, want more than 0", report.Savings())
+			}
+
+			if dryRun {
+				if uploads != 0 || updated != nil {
+					t.Errorf("Images.Optimize modified content during a dry run")
+				}
+				return
+			}
+
+			if uploads != 1 {
+				t.Errorf("Images.Optimize uploaded %d images, want 1", uploads)
+			}
+			if updated == nil {
+				t.Fatalf("Images.Optimize did not update the post")
+			}
+			if *updated.FeatureImage != newURL {
+				t.Errorf("Images.Optimize set feature image %v, want %v", *updated.FeatureImage, newURL)
+			}
+			want := strings.Replace(mobiledoc, largeURL, newURL, 1)
+			if *updated.Mobiledoc != want {
+				t.Errorf("Images.Optimize set mobiledoc %v, want %v", *updated.Mobiledoc, want)
+			}
+		})
+	}
+}
+
+// testJPEG encodes a width x height jpeg whose left half is dark and right
+// half light, with the raw segment inserted right after the start of image
+// marker. It is encoded at full quality so that re-encoding shrinks it.
+func testJPEG(t *testing.T, width, height int, segment []byte) []byte {
+	t.Helper()
+	m := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(x*y) % 32
+			if x >= width/2 {
+				v += 200
+			}
+			m.SetGray(x, y, color.Gray{v})
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, m, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	return append(append(append([]byte{}, b[:2]...), segment...), b[2:]...)
+}
+
+func TestImagesService_Optimize_updateFailure(t *testing.T) {
+	client, mux, serverURL, teardown := setup()
+	defer teardown()
+
+	large := testPNG(t, 64, 64)
+	mux.HandleFunc("/content/images/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(large)
+	})
+	mux.HandleFunc(BaseAdminPath+"posts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"posts": [
+			{"id": "1", "feature_image": "%[1]s/content/images/a.png"},
+			{"id": "2", "feature_image": "%[1]s/content/images/b.png"}
+		]}`, serverURL)
+	})
+	mux.HandleFunc(BaseAdminPath+"images/upload/", func(w http.ResponseWriter, r *http.Request) {
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(w, `{"images": [{"url": "%s/content/images/new/%s"}]}`, serverURL, header.Filename)
+	})
+	mux.HandleFunc(BaseAdminPath+"posts/1/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+	var updated bool
+	mux.HandleFunc(BaseAdminPath+"posts/2/", func(w http.ResponseWriter, r *http.Request) {
+		updated = true
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	report, err := client.Images.Optimize(&ImageOptimizeOptions{MaxWidth: 16})
+	if err != nil {
+		t.Fatalf("Images.Optimize returned error: %v", err)
+	}
+
+	if !updated {
+		t.Errorf("Images.Optimize stopped after the failed update")
+	}
+	// the image uploaded for post 1 is unused, so it is a failure too
+	if len(report.Failures) != 2 ||
+		report.Failures[0].PostID != "1" || report.Failures[0].Err == nil ||
+		report.Failures[1].URL != serverURL+"/content/images/a.png" || report.Failures[1].Err == nil {
+		t.Errorf("Images.Optimize reported failures %+v, want post 1 and a.png", report.Failures)
+	}
+	if len(report.Images) != 1 {
+		t.Fatalf("Images.Optimize optimized %d images, want 1", len(report.Images))
+	}
+	if !reflect.DeepEqual(report.Images[0].PostIDs, []string{"2"}) {
+		t.Errorf("Images.Optimize reported %v as rewritten, want [2]", report.Images[0].PostIDs)
+	}
+	if report.Savings() != report.Images[0].Savings() {
+		t.Errorf("Images.Optimize saved %d bytes, want only those of b.png", report.Savings())
+	}
+}
+
+func TestImagesService_Optimize_revisitedPost(t *testing.T) {
+	client, mux, serverURL, teardown := setup()
+	defer teardown()
+
+	large := testPNG(t, 64, 64)
+	mux.HandleFunc("/content/images/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(large)
+	})
+	// the second page lists the already rewritten post again
+	mux.HandleFunc(BaseAdminPath+"posts/", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("page") == "1" {
+			fmt.Fprintf(w, `{"posts": [{"id": "1", "feature_image": "%s/content/images/a.png"}],
+				"meta": {"pagination": {"next": 2}}}`, serverURL)
+		} else {
+			fmt.Fprintf(w, `{"posts": [{"id": "1", "feature_image": "%s/content/images/new.png"}]}`, serverURL)
+		}
+	})
+	var uploads, updates int
+	mux.HandleFunc(BaseAdminPath+"images/upload/", func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		fmt.Fprintf(w, `{"images": [{"url": "%s/content/images/new.png"}]}`, serverURL)
+	})
+	mux.HandleFunc(BaseAdminPath+"posts/1/", func(w http.ResponseWriter, r *http.Request) {
+		updates++
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	_, err := client.Images.Optimize(&ImageOptimizeOptions{MaxWidth: 16})
+	if err != nil {
+		t.Fatalf("Images.Optimize returned error: %v", err)
+	}
+	if uploads != 1 || updates != 1 {
+		t.Errorf("Images.Optimize made %d uploads and %d updates, want 1 each", uploads, updates)
+	}
+}
+
+func TestImagesService_Optimize_siteURL(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+
+	large := testPNG(t, 64, 64)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(large)
+	}))
+	defer site.Close()
+
+	mux.HandleFunc(BaseAdminPath+"posts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"posts": [{"id": "1", "feature_image": "%s/content/images/a.png"}]}`, site.URL)
+	})
+
+	report, err := client.Images.Optimize(&ImageOptimizeOptions{MaxWidth: 16, DryRun: true})
+	if err != nil {
+		t.Fatalf("Images.Optimize returned error: %v", err)
+	}
+	if report.Scanned != 0 {
+		t.Errorf("Images.Optimize scanned %d images outside the admin url, want 0", report.Scanned)
+	}
+
+	report, err = client.Images.Optimize(&ImageOptimizeOptions{MaxWidth: 16, SiteURL: site.URL, DryRun: true})
+	if err != nil {
+		t.Fatalf("Images.Optimize returned error: %v", err)
+	}
+	if report.Scanned != 1 || len(report.Images) != 1 {
+		t.Errorf("Images.Optimize scanned %d and optimized %d images, want 1 each", report.Scanned, len(report.Images))
+	}
+}
+
+func TestImagesService_Optimize_unsafeImages(t *testing.T) {
+	client, mux, serverURL, teardown := setup()
+	defer teardown()
+
+	// an EXIF segment whose only IFD0 entry is orientation 6, rotated 90°
+	exif := []byte("\xff\xe1\x00\x22Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08" +
+		"\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	profile := []byte("not really an icc profile")
+	icc := append([]byte("\xff\xe2\x00\x29ICC_PROFILE\x00\x01\x01"), profile...)
+	profilePNG, err := embedICCProfile(testPNG(t, 48, 48), "image/png", profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := map[string][]byte{
+		"rotated.jpg": testJPEG(t, 64, 32, exif),
+		"profile.jpg": testJPEG(t, 64, 32, icc),
+		"profile.png": profilePNG,
+		"huge.png":    testPNG(t, 64, 64),
+		"anim.gif":    []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"),
+		"logo.svg":    []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`),
+	}
+	mux.HandleFunc("/content/images/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(images[path.Base(r.URL.Path)])
+	})
+	var html string
+	for name := range images {
+		// unquoted attributes must not swallow the closing bracket
+		html += fmt.Sprintf("<img src=%s/content/images/%s>", serverURL, name)
+	}
+	mux.HandleFunc(BaseAdminPath+"posts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"posts": [{"id": "1", "html": %q}]}`, html)
+	})
+	uploads := make(map[string][]byte)
+	mux.HandleFunc(BaseAdminPath+"images/upload/", func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		uploads[header.Filename], _ = ioutil.ReadAll(file)
+		fmt.Fprintf(w, `{"images": [{"url": "%s/content/images/new/%s"}]}`, serverURL, header.Filename)
+	})
+	mux.HandleFunc(BaseAdminPath+"posts/1/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	report, err := client.Images.Optimize(&ImageOptimizeOptions{MinSize: 1, MaxPixels: 3000})
+	if err != nil {
+		t.Fatalf("Images.Optimize returned error: %v", err)
+	}
+	if report.Scanned != len(images) {
+		t.Errorf("Images.Optimize scanned %d images, want %d", report.Scanned, len(images))
+	}
+	if len(report.Failures) != 1 || report.Failures[0].URL != serverURL+"/content/images/huge.png" {
+		t.Errorf("Images.Optimize reported failures %+v, want huge.png", report.Failures)
+	}
+	if len(report.Images) != 3 {
+		t.Errorf("Images.Optimize optimized %d images, want 3", len(report.Images))
+	}
+
+	// the rotated image is stored upright, its light half now at the bottom
+	rotated, err := jpeg.Decode(bytes.NewReader(uploads["rotated.jpg"]))
+	if err != nil {
+		t.Fatalf("rotated.jpg was not uploaded: %v", err)
+	}
+	if b := rotated.Bounds(); b.Dx() != 32 || b.Dy() != 64 {
+		t.Errorf("rotated.jpg was uploaded as %v, want 32x64", b)
+	}
+	top, _, _, _ := rotated.At(16, 8).RGBA()
+	bottom, _, _, _ := rotated.At(16, 56).RGBA()
+	if top >= bottom {
+		t.Errorf("rotated.jpg was uploaded the wrong way up")
+	}
+	if meta := jpegMetadata(uploads["rotated.jpg"]); meta.Orientation != 0 {
+		t.Errorf("rotated.jpg was uploaded with orientation %d", meta.Orientation)
+	}
+
+	if meta := jpegMetadata(uploads["profile.jpg"]); !bytes.Equal(meta.ICCProfile, profile) {
+		t.Errorf("profile.jpg was uploaded with profile %q, want %q", meta.ICCProfile, profile)
+	}
+	if _, err := png.Decode(bytes.NewReader(uploads["profile.png"])); err != nil {
+		t.Errorf("profile.png was uploaded as an invalid png: %v", err)
+	}
+	if got, _ := pngICCProfile(uploads["profile.png"]); !bytes.Equal(got, profile) {
+		t.Errorf("profile.png was uploaded with profile %q, want %q", got, profile)
+	}
+}
@@ -0,0 +1,443 @@
+package ghost
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxImageWidth is the width images are scaled down to when no
+	// MaxWidth is given.
+	DefaultMaxImageWidth = 2000
+
+	// DefaultMinImageSize is the size in bytes above which an image is
+	// considered oversized when no MinSize is given.
+	DefaultMinImageSize = 500 * 1024
+
+	// DefaultMaxImagePixels is the largest number of pixels an image may have
+	// to be decoded when no MaxPixels is given.
+	DefaultMaxImagePixels = 50 * 1000 * 1000
+
+	// contentImagesPath is where Ghost serves uploaded images from.
+	contentImagesPath = "/content/images/"
+
+	// maxImageDownloadSize bounds how much of an image is read into memory.
+	maxImageDownloadSize = 64 * 1024 * 1024
+)
+
+// ImageEncoder encodes the (possibly resized) image m to w. format is the name
+// of the original format as reported by image.Decode, e.g. "jpeg". It returns
+// the file extension and mime type of what was written, which allows plugging
+// in encoders the standard library lacks.
+type ImageEncoder func(w io.Writer, m image.Image, format string) (ext, contentType string, err error)
+
+// EncodeStandardImage is the default ImageEncoder. PNGs are kept as PNG to
+// preserve transparency and everything else is written as a JPEG.
+//
+// No WebP encoder is provided: the standard library cannot write WebP, and the
+// v3 Admin API this package targets only accepts jpg, gif, png, svg and ico
+// uploads. Instances that do accept WebP can supply their own ImageEncoder.
+func EncodeStandardImage(w io.Writer, m image.Image, format string) (string, string, error) {
+	if format == "png" {
+		enc := &png.Encoder{CompressionLevel: png.BestCompression}
+		return ".png", "image/png", enc.Encode(w, m)
+	}
+	return ".jpg", "image/jpeg", jpeg.Encode(w, m, &jpeg.Options{Quality: 80})
+}
+
+// ImageOptimizeOptions configure which images Optimize considers oversized
+// and what it does with them.
+type ImageOptimizeOptions struct {
+	// MaxWidth is the width in pixels images are scaled down to.
+	MaxWidth int
+
+	// MinSize is the size in bytes above which an image is re-encoded even
+	// if it is not too wide.
+	MinSize int
+
+	// MaxPixels is the largest width times height an image may have to be
+	// decoded. Larger images are reported as failures.
+	MaxPixels int
+
+	// SiteURL is the public url of the site, which is where its images are
+	// served from, e.g. https://blah.pubbit.io. Only images under SiteURL are
+	// optimized. Defaults to the url the client was created with, which must
+	// be set explicitly for instances with a separate admin url.
+	SiteURL string
+
+	// HTTPClient is used to download images. It should not carry the admin
+	// credentials, as images may redirect to other hosts. Defaults to a plain
+	// client with a timeout.
+	HTTPClient *http.Client
+
+	// Encoder encodes the optimized images. Defaults to EncodeStandardImage.
+	Encoder ImageEncoder
+
+	// DryRun only reports the expected savings, without uploading images or
+	// updating posts.
+	DryRun bool
+}
+
+// ImageOptimization is the result of optimizing a single image.
+type ImageOptimization struct {
+	URL           string
+	NewURL        string
+	OriginalSize  int
+	OptimizedSize int
+	// PostIDs are the posts rewritten to use NewURL, or for a dry run the
+	// posts that would have been.
+	PostIDs []string
+}
+
+// Savings returns the number of bytes saved by the optimization.
+func (o ImageOptimization) Savings() int {
+	return o.OriginalSize - o.OptimizedSize
+}
+
+func (o ImageOptimization) String() string {
+	return Stringify(o)
+}
+
+// ImageOptimizationFailure is an image that could not be optimized, or a post
+// that could not be rewritten, in which case PostID is set. Failures are not
+// fatal to the run, as one broken image or post should not stop the rest.
+type ImageOptimizationFailure struct {
+	URL    string
+	PostID string
+	Err    error
+}
+
+// ImageOptimizationReport is the outcome of an Optimize run.
+type ImageOptimizationReport struct {
+	// Scanned is the number of distinct images under the site url that were
+	// examined.
+	Scanned  int
+	Images   []*ImageOptimization
+	Failures []*ImageOptimizationFailure
+}
+
+// Savings returns the total number of bytes saved across all images.
+func (r ImageOptimizationReport) Savings() int {
+	var total int
+	for _, img := range r.Images {
+		total += img.Savings()
+	}
+	return total
+}
+
+// Optimize walks all posts looking for oversized jpegs and pngs hosted by the
+// Ghost instance, uploads resized and re-encoded versions of them, then
+// rewrites the posts to reference the new images. Images are only replaced when
+// doing so actually saves space. Their EXIF orientation is applied and their
+// color profile carried over, so they display as before. Other formats are left
+// alone. With DryRun set nothing is modified, and the report holds the savings
+// that would have been made.
+//
+// Uploaded images that no post could be rewritten to use are reported as
+// failures rather than savings. If listing posts fails the run stops, and the
+// report of what was changed so far is returned along with the error.
+func (s *AdminImagesService) Optimize(opts *ImageOptimizeOptions) (*ImageOptimizationReport, error) {
+	o := ImageOptimizeOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxWidth <= 0 {
+		o.MaxWidth = DefaultMaxImageWidth
+	}
+	if o.MinSize <= 0 {
+		o.MinSize = DefaultMinImageSize
+	}
+	if o.MaxPixels <= 0 {
+		o.MaxPixels = DefaultMaxImagePixels
+	}
+	if o.SiteURL == "" {
+		burl := s.client.BaseURL
+		o.SiteURL = burl.Scheme + "://" + burl.Host + strings.TrimSuffix(burl.Path, BaseAdminPath)
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: time.Minute}
+	}
+	if o.Encoder == nil {
+		o.Encoder = EncodeStandardImage
+	}
+
+	imagesPrefix := strings.TrimSuffix(o.SiteURL, "/") + contentImagesPath
+	imageRegexp := regexp.MustCompile(regexp.QuoteMeta(imagesPrefix) + `[^"'\s\\)<>]+`)
+	// the resized copies Ghost generates itself are left alone
+	generatedPrefix := imagesPrefix + "size/"
+	report := &ImageOptimizationReport{}
+	// images are keyed by url so images shared between posts are only
+	// processed once; a nil entry means the image was left as is.
+	seen := make(map[string]*ImageOptimization)
+	// urls uploaded by this run, which must not be optimized again should a
+	// post be listed twice.
+	uploaded := make(map[string]bool)
+
+	// posts are listed by id so that updating them does not shift the pages
+	listParams := &ListParams{Limit: 50, Page: 1, Order: "id asc"}
+	for {
+		postsResponse, err := s.client.Posts.List(listParams)
+		if err != nil {
+			report.dropUnused(o.DryRun)
+			return report, err
+		}
+
+		for _, post := range postsResponse.Posts {
+			var optimized []*ImageOptimization
+			replacements := make(map[string]string)
+			for _, u := range postImageURLs(post, imageRegexp) {
+				if strings.HasPrefix(u, generatedPrefix) || uploaded[u] {
+					continue
+				}
+				opt, ok := seen[u]
+				if !ok {
+					report.Scanned++
+					opt, err = s.optimizeImage(u, &o)
+					if err != nil {
+						report.Failures = append(report.Failures, &ImageOptimizationFailure{URL: u, Err: err})
+					} else if opt != nil {
+						report.Images = append(report.Images, opt)
+						uploaded[opt.NewURL] = true
+					}
+					seen[u] = opt
+				}
+				if opt == nil {
+					continue
+				}
+
+				optimized = append(optimized, opt)
+				replacements[u] = opt.NewURL
+			}
+
+			if len(replacements) == 0 {
+				continue
+			}
+			if !o.DryRun {
+				rewritePostImages(post, replacements)
+				_, err = s.client.Posts.Update(post)
+				if err != nil {
+					report.Failures = append(report.Failures, &ImageOptimizationFailure{PostID: *post.ID, Err: err})
+					continue
+				}
+			}
+			for _, opt := range optimized {
+				opt.PostIDs = append(opt.PostIDs, *post.ID)
+			}
+		}
+
+		if postsResponse.Meta == nil || postsResponse.Meta.Pagination == nil ||
+			postsResponse.Meta.Pagination.Next == nil {
+			break
+		}
+		listParams.Page = *postsResponse.Meta.Pagination.Next
+	}
+
+	report.dropUnused(o.DryRun)
+	return report, nil
+}
+
+// dropUnused moves images that were uploaded but that no post was rewritten
+// to use into the failures, as they save nothing.
+func (r *ImageOptimizationReport) dropUnused(dryRun bool) {
+	if dryRun {
+		return
+	}
+
+	var used []*ImageOptimization
+	for _, img := range r.Images {
+		if len(img.PostIDs) > 0 {
+			used = append(used, img)
+			continue
+		}
+		r.Failures = append(r.Failures, &ImageOptimizationFailure{
+			URL: img.URL,
+			Err: fmt.Errorf("uploaded as %s but no post could be rewritten to use it", img.NewURL),
+		})
+	}
+	r.Images = used
+}
+
+// postImageURLs returns the distinct image urls referenced by the post.
+func postImageURLs(post *Post, imageRegexp *regexp.Regexp) []string {
+	var urls []string
+	found := make(map[string]bool)
+	for _, field := range []*string{post.FeatureImage, post.OgImage, post.TwitterImage, post.Mobiledoc, post.HTML} {
+		if field == nil {
+			continue
+		}
+		for _, u := range imageRegexp.FindAllString(*field, -1) {
+			if !found[u] {
+				found[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls
+}
+
+// rewritePostImages replaces every reference to the old image urls in the
+// post with the new ones.
+func rewritePostImages(post *Post, replacements map[string]string) {
+	var oldnew []string
+	for from, to := range replacements {
+		oldnew = append(oldnew, from, to)
+	}
+	r := strings.NewReplacer(oldnew...)
+	for _, field := range []*string{post.FeatureImage, post.OgImage, post.TwitterImage, post.Mobiledoc, post.HTML} {
+		if field != nil {
+			*field = r.Replace(*field)
+		}
+	}
+}
+
+// optimizeImage downloads the image at u and re-encodes it if it is
+// oversized. It returns nil when the image should be left alone.
+func (s *AdminImagesService) optimizeImage(u string, opts *ImageOptimizeOptions) (*ImageOptimization, error) {
+	resp, err := opts.HTTPClient.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received %v status fetching image", resp.StatusCode)
+	}
+	src, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxImageDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(src) > maxImageDownloadSize {
+		return nil, fmt.Errorf("image is larger than %d bytes", maxImageDownloadSize)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(src))
+	if err == image.ErrFormat {
+		// gifs, svgs, icons and the like are left as they are
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if format != "jpeg" && format != "png" {
+		// formats registered elsewhere, which may be animated
+		return nil, nil
+	}
+
+	meta, err := readImageMetadata(src, format)
+	if err != nil {
+		return nil, err
+	}
+	width := config.Width
+	if meta.Orientation >= 5 {
+		width = config.Height
+	}
+	if width <= opts.MaxWidth && len(src) <= opts.MinSize {
+		return nil, nil
+	}
+	if config.Width*config.Height > opts.MaxPixels {
+		return nil, fmt.Errorf("image is %dx%d, more than %d pixels", config.Width, config.Height, opts.MaxPixels)
+	}
+
+	m, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	// the re-encoded image has no EXIF, so it must be stored upright
+	m = orientImage(m, meta.Orientation)
+	if width > opts.MaxWidth {
+		m = resizeImage(m, opts.MaxWidth)
+	}
+
+	buf := &bytes.Buffer{}
+	ext, contentType, err := opts.Encoder(buf, m, format)
+	if err != nil {
+		return nil, err
+	}
+	encoded := buf.Bytes()
+	if meta.ICCProfile != nil {
+		encoded, err = embedICCProfile(encoded, contentType, meta.ICCProfile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(encoded) >= len(src) {
+		return nil, nil
+	}
+
+	opt := &ImageOptimization{
+		URL:           u,
+		OriginalSize:  len(src),
+		OptimizedSize: len(encoded),
+	}
+	if opts.DryRun {
+		return opt, nil
+	}
+
+	base := path.Base(u)
+	filename := strings.TrimSuffix(base, path.Ext(base)) + ext
+	img, err := s.Upload(filename, contentType, bytes.NewReader(encoded), u)
+	if err != nil {
+		return nil, err
+	}
+	if img.URL == nil {
+		return nil, fmt.Errorf("received unexpected response format")
+	}
+	opt.NewURL = *img.URL
+	return opt, nil
+}
+
+// resizeImage scales m down to width, keeping its aspect ratio. Each
+// destination pixel is the average of the source pixels it covers.
+func resizeImage(m image.Image, width int) image.Image {
+	b := m.Bounds()
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy0 := b.Min.Y + y*b.Dy()/height
+		sy1 := b.Min.Y + (y+1)*b.Dy()/height
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < width; x++ {
+			sx0 := b.Min.X + x*b.Dx()/width
+			sx1 := b.Min.X + (x+1)*b.Dx()/width
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					pr, pg, pb, pa := m.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					bl += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
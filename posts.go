@@ -131,3 +131,35 @@ func (s *AdminPostsService) List(listParams *ListParams) (*PostsResponse, error)
 
 	return postsResponse, nil
 }
+
+// postsWrapper is the form of the request body Ghost expects for post edits.
+type postsWrapper struct {
+	Posts []*Post `json:"posts"`
+}
+
+// Update updates the post, returning the post as saved by Ghost. Since every
+// field is sent, post should be a full post as fetched via Get or List, with
+// any modifications applied. UpdatedAt must be left as fetched; Ghost uses it
+// to detect conflicting edits.
+func (s *AdminPostsService) Update(post *Post) (*Post, error) {
+	if post.ID == nil {
+		return nil, fmt.Errorf("post must have an id to be updated")
+	}
+
+	u := fmt.Sprintf("posts/%v/", *post.ID)
+	req, err := s.client.NewRequest("PUT", u, &postsWrapper{Posts: []*Post{post}})
+	if err != nil {
+		return nil, err
+	}
+
+	postsResponse := new(PostsResponse)
+	_, err = s.client.Do(req, postsResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(postsResponse.Posts) != 1 {
+		return nil, fmt.Errorf("received unexpected response format")
+	}
+	return postsResponse.Posts[0], nil
+}
@@ -1,6 +1,7 @@
 package ghost
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -279,3 +280,49 @@ func TestPostsService_List(t *testing.T) {
 		t.Errorf("Posts.List returned %+v, want %+v", post, want)
 	}
 }
+
+func TestPostsService_Update(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+
+	fetched := `{"slug":"a","id":"1","title":"a","mobiledoc":"{}","status":"draft","updated_at":"2019-11-26T02:44:17Z"}`
+	mux.HandleFunc(BaseAdminPath+"posts/1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprintf(w, `{ "posts": [%s] }`, fetched)
+	})
+
+	want := &Post{
+		Slug:      String("a"),
+		ID:        String("1"),
+		Title:     String("b"),
+		Mobiledoc: String("{}"),
+		Status:    String("draft"),
+		UpdatedAt: Time("2019-11-26T02:44:17Z"),
+	}
+	mux.HandleFunc(BaseAdminPath+"posts/1/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PUT")
+		wrapper := new(postsWrapper)
+		if err := json.NewDecoder(r.Body).Decode(wrapper); err != nil {
+			t.Fatal(err)
+		}
+		if len(wrapper.Posts) != 1 || !reflect.DeepEqual(wrapper.Posts[0], want) {
+			t.Errorf("Posts.Update sent %+v, want %+v", wrapper.Posts, want)
+		}
+		json.NewEncoder(w).Encode(wrapper)
+	})
+
+	// posts are updated as fetched, so that no fields are cleared
+	post, err := client.Posts.Get("1")
+	if err != nil {
+		t.Fatalf("Posts.Get returned error: %v", err)
+	}
+	post.Title = String("b")
+
+	post, err = client.Posts.Update(post)
+	if err != nil {
+		t.Errorf("Posts.Update returned error: %v", err)
+	}
+	if !reflect.DeepEqual(post, want) {
+		t.Errorf("Posts.Update returned %+v, want %+v", post, want)
+	}
+}